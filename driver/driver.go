@@ -0,0 +1,128 @@
+// Package driver holds the Driver interface that every database driver
+// implements, along with the registry drivers use to make themselves
+// available to the top-level migrate package by URL scheme.
+package driver
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+
+	"github.com/mattes/migrate/file"
+)
+
+// Driver is the interface type that needs to implemented by all drivers.
+type Driver interface {
+	// Initialize opens and verifies the connection to the database
+	// and stores the connection for further usage.
+	Initialize(url string) error
+
+	// Close closes the connection to the database.
+	Close() error
+
+	// FilenameExtension returns the extension of the migration files.
+	// The returned string must not begin with a dot.
+	FilenameExtension() string
+
+	// Migrate is the heart of the driver. It will receive a file
+	// which the driver should apply to its database. It is
+	// responsible for inserting or deleting a new migration row
+	// from the schema_migrations table on success/failure.
+	Migrate(file file.File, pipe chan interface{})
+
+	// Version returns the current migration version.
+	Version() (uint64, error)
+}
+
+// Forcer is implemented by drivers that can unconditionally mark a
+// migration as applied and clear its dirty flag, without running any
+// migration SQL. It is used to recover a driver after a failed
+// migration left the schema_migrations table dirty.
+type Forcer interface {
+	Force(version uint64) error
+}
+
+// OptionSetter is implemented by drivers that accept programmatic
+// overrides of their defaults (e.g. the postgres driver's migrations
+// table/schema) in addition to whatever they parse from the connection
+// URL in Initialize. It lets callers configure a driver without needing
+// to round-trip their settings through URL query parameters, and lets
+// other drivers adopt the same option surface as they need it. Use
+// NewWithOptions to get a driver with options already applied.
+type OptionSetter interface {
+	SetOptions(options map[string]string) error
+}
+
+var drivers = make(map[string]Driver)
+
+// Register registers a driver by scheme (e.g. "postgres") so that New
+// can instantiate it by URL. It panics if Register is called twice for
+// the same scheme, or if driver is nil, analogous to database/sql.
+func Register(name string, driver Driver) {
+	if driver == nil {
+		panic("driver: Register driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("driver: Register called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// New returns a new, freshly Initialize'd driver instance for the given
+// URL's scheme. Each call gets its own instance (built by reflection off
+// the registered prototype) so that concurrent callers don't share
+// driver state such as the configured migrations table.
+func New(url string) (Driver, error) {
+	scheme, err := parseScheme(url)
+	if err != nil {
+		return nil, err
+	}
+
+	prototype, ok := drivers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("driver: unknown driver %q (forgotten import?)", scheme)
+	}
+
+	d := reflect.New(reflect.TypeOf(prototype).Elem()).Interface().(Driver)
+	if err := d.Initialize(url); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// NewWithOptions is like New, but also applies options to the freshly
+// built driver via OptionSetter before returning it. Unlike Force (which
+// opens, acts, and closes a driver in one shot), options configure a
+// driver for migrations still to come, so they have to land on the same
+// instance the caller goes on to use; New alone can't do that since each
+// call returns its own, separately configured instance. It returns an
+// error if the driver for url's scheme doesn't implement OptionSetter.
+func NewWithOptions(url string, options map[string]string) (Driver, error) {
+	d, err := New(url)
+	if err != nil {
+		return nil, err
+	}
+
+	setter, ok := d.(OptionSetter)
+	if !ok {
+		d.Close()
+		return nil, fmt.Errorf("driver: driver does not support SetOptions")
+	}
+
+	if err := setter.SetOptions(options); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func parseScheme(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" {
+		return "", fmt.Errorf("driver: no scheme found in URL %q", rawURL)
+	}
+	return u.Scheme, nil
+}
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ensureSchemaMigrationsTable makes sure the migrations table exists with
+// the current (version, dirty, applied_at) layout, transparently
+// upgrading installations that still have the original single-column
+// form. Migrate calls this once per migration file, so the work is
+// skipped after the first call on a given Driver: every one of these
+// statements takes an ACCESS EXCLUSIVE lock on the table, and re-issuing
+// them on every single migration step would mean needless lock
+// contention for the rest of a multi-file run.
+func (driver *Driver) ensureSchemaMigrationsTable(exec func(string, ...interface{}) error) error {
+	if driver.createdVersionTable {
+		return nil
+	}
+
+	if err := exec("CREATE TABLE IF NOT EXISTS " + driver.quotedTableName() +
+		" (version bigint not null primary key, dirty boolean not null default false, applied_at timestamptz default now());"); err != nil {
+		return err
+	}
+
+	// A table created before this layout existed only has a version
+	// column, and a plain int one at that; widen it and add the missing
+	// columns in place rather than requiring a separate, manual migration
+	// step.
+	if err := exec("ALTER TABLE " + driver.quotedTableName() + " ALTER COLUMN version TYPE bigint;"); err != nil {
+		return err
+	}
+	if err := exec("ALTER TABLE " + driver.quotedTableName() + " ADD COLUMN IF NOT EXISTS dirty boolean not null default false;"); err != nil {
+		return err
+	}
+	if err := exec("ALTER TABLE " + driver.quotedTableName() + " ADD COLUMN IF NOT EXISTS applied_at timestamptz default now();"); err != nil {
+		return err
+	}
+
+	driver.createdVersionTable = true
+	return nil
+}
+
+// isDirty reports whether any version in the migrations table is marked
+// dirty, meaning a previous migration failed partway through and the
+// operator needs to call Force before migrating further. In simulate
+// mode ensureSchemaMigrationsTable never actually creates the table, so
+// there is nothing to query; simulate runs are always reported clean.
+func (driver *Driver) isDirty(ctx context.Context, conn *sql.Conn) (bool, error) {
+	if driver.simulate {
+		return false, nil
+	}
+	var dirty bool
+	err := conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+driver.quotedTableName()+" WHERE dirty)").Scan(&dirty)
+	return dirty, err
+}
+
+// Force marks version as applied and clears its dirty flag without
+// running any migration SQL. It is the operator's way out of a dirty
+// schema_migrations row left behind by a failed migration: fix up the
+// schema by hand, then call Force to tell migrate it's safe to continue.
+func (driver *Driver) Force(version uint64) error {
+	if err := driver.ensureSchemaMigrationsTable(func(q string, args ...interface{}) error {
+		_, err := driver.db.Exec(q, args...)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	_, err := driver.db.Exec(fmt.Sprintf(
+		"INSERT INTO %s (version, dirty) VALUES (%v, false) ON CONFLICT (version) DO UPDATE SET dirty = false",
+		driver.quotedTableName(), version))
+	return err
+}
@@ -0,0 +1,28 @@
+package postgres
+
+import "testing"
+
+func TestEnsureSchemaMigrationsTableRunsOnceThenSkips(t *testing.T) {
+	driver := &Driver{}
+
+	var calls int
+	exec := func(string, ...interface{}) error {
+		calls++
+		return nil
+	}
+
+	if err := driver.ensureSchemaMigrationsTable(exec); err != nil {
+		t.Fatalf("ensureSchemaMigrationsTable returned error: %v", err)
+	}
+	if calls == 0 {
+		t.Fatalf("expected the first call to issue statements")
+	}
+
+	first := calls
+	if err := driver.ensureSchemaMigrationsTable(exec); err != nil {
+		t.Fatalf("ensureSchemaMigrationsTable returned error: %v", err)
+	}
+	if calls != first {
+		t.Fatalf("expected a second call on the same driver to skip re-issuing statements, went from %d to %d calls", first, calls)
+	}
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mattes/migrate/file"
+	"github.com/mattes/migrate/migrate/direction"
+)
+
+// goMigration holds the up/down functions for a single version's
+// registered Go migration. Either may be nil, in which case migrating in
+// that direction is a no-op.
+type goMigration struct {
+	up, down func(tx *sql.Tx) error
+}
+
+var goMigrations = make(map[uint64]goMigration)
+
+// RegisterMigration registers up and down functions for a Go migration
+// at version, so that Driver.Migrate can run it for a version that has
+// no .sql file (see RegisteredVersions and file.MergeRegistered); where
+// a .sql file of the same version exists, only that file is run. This is
+// for data migrations that need conditional logic, batched updates, or
+// access to application packages that plain SQL can't express; the
+// function runs in a transaction of its own, together with the version's
+// bookkeeping statement.
+func RegisterMigration(version uint64, up, down func(tx *sql.Tx) error) {
+	goMigrations[version] = goMigration{up: up, down: down}
+}
+
+// RegisteredVersions returns the versions that have a registered Go
+// migration, sorted ascending, for the migrate loop's directory scan to
+// pass to file.MergeRegistered so a version with no .sql file still gets
+// discovered and routed into Driver.Migrate.
+func RegisteredVersions() []uint64 {
+	versions := make([]uint64, 0, len(goMigrations))
+	for version := range goMigrations {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// runGoMigration runs the registered Go migration for f.Version in the
+// direction f.Direction, inside its own transaction. f's bookkeeping
+// statement (see bookkeepingSQL) runs as the last statement of that same
+// tx, so a crash between the migration function returning and the
+// follow-up update can't leave a fully-applied migration marked dirty.
+func (driver *Driver) runGoMigration(ctx context.Context, conn *sql.Conn, pipe chan interface{}, f file.File) error {
+	migration, ok := goMigrations[f.Version]
+	if !ok {
+		err := errors.New(fmt.Sprintf("no Go migration registered for version %v", f.Version))
+		pipe <- err
+		return err
+	}
+
+	fn := migration.up
+	if f.Direction == direction.Down {
+		fn = migration.down
+	}
+
+	if driver.simulate {
+		pipe <- fmt.Sprintf("--------------------------------\n-- Go migration for version %v", f.Version)
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		pipe <- err
+		return err
+	}
+
+	// fn is nil for a direction the caller registered no function for,
+	// which is a no-op migration, not a skipped one: it still needs its
+	// bookkeeping statement run so the version is recorded as applied
+	// (or removed) rather than left dirty forever.
+	if fn != nil {
+		if err := fn(tx); err != nil {
+			pipe <- err
+			if rbErr := tx.Rollback(); rbErr != nil {
+				pipe <- rbErr
+			}
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(driver.bookkeepingSQL(f)); err != nil {
+		pipe <- err
+		if rbErr := tx.Rollback(); rbErr != nil {
+			pipe <- rbErr
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		pipe <- err
+		return err
+	}
+	return nil
+}
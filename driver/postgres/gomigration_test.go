@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/mattes/migrate/file"
+	"github.com/mattes/migrate/migrate/direction"
+)
+
+func TestRegisteredMigrationIsDiscoveredAndRun(t *testing.T) {
+	defer delete(goMigrations, 9999)
+
+	var ran bool
+	RegisterMigration(9999, func(tx *sql.Tx) error {
+		ran = true
+		return nil
+	}, nil)
+
+	var registered bool
+	for _, v := range RegisteredVersions() {
+		if v == 9999 {
+			registered = true
+		}
+	}
+	if !registered {
+		t.Fatalf("expected RegisteredVersions to include 9999, got %v", RegisteredVersions())
+	}
+
+	// No .sql file exists for version 9999; MergeRegistered (the
+	// discovery-side counterpart of RegisterMigration) must still
+	// surface it as a Kind Go file so Driver.Migrate routes it to
+	// runGoMigration instead of trying to read a nonexistent .sql file.
+	files := file.MergeRegistered(nil, RegisteredVersions(), direction.Up)
+
+	var f file.File
+	var found bool
+	for _, candidate := range files {
+		if candidate.Version == 9999 {
+			f, found = candidate, true
+		}
+	}
+	if !found {
+		t.Fatalf("expected discovery to synthesize a file for version 9999, got %#v", files)
+	}
+	if f.Kind != file.Go {
+		t.Fatalf("expected synthesized file to have Kind Go, got %v", f.Kind)
+	}
+
+	migration, ok := goMigrations[f.Version]
+	if !ok || migration.up == nil {
+		t.Fatalf("expected an up function registered for version %v", f.Version)
+	}
+	if err := migration.up(nil); err != nil {
+		t.Fatalf("migration.up returned error: %v", err)
+	}
+	if !ran {
+		t.Fatalf("expected the registered up function to run")
+	}
+}
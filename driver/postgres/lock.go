@@ -0,0 +1,15 @@
+package postgres
+
+import "hash/fnv"
+
+// LockKey derives the int64 key used for the Postgres advisory lock that
+// guards migrations against being run concurrently by more than one
+// process. It is a deterministic hash of the fully qualified migrations
+// table name, so drivers configured with distinct x-migrations-table or
+// x-migrations-schema values (see SetOptions) take out distinct locks
+// and don't contend with one another.
+func LockKey(qualifiedTableName string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(qualifiedTableName))
+	return int64(h.Sum64())
+}
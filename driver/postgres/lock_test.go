@@ -0,0 +1,16 @@
+package postgres
+
+import "testing"
+
+func TestLockKeyIsDeterministicAndDistinct(t *testing.T) {
+	a := LockKey(`"schema_migrations"`)
+	b := LockKey(`"schema_migrations"`)
+	if a != b {
+		t.Fatalf("expected LockKey to be deterministic, got %v and %v", a, b)
+	}
+
+	c := LockKey(`"ops"."schema_migrations"`)
+	if a == c {
+		t.Fatalf("expected distinct qualified table names to produce distinct keys")
+	}
+}
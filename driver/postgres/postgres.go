@@ -2,25 +2,96 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/lib/pq"
+	"github.com/mattes/migrate/driver"
 	"github.com/mattes/migrate/file"
 	"github.com/mattes/migrate/migrate/direction"
+	"net/url"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
+func init() {
+	driver.Register("postgres", &Driver{})
+}
+
 type Driver struct {
 	db                  *sql.DB
 	simulate            bool
 	createdVersionTable bool
+
+	migrationsTable  string
+	migrationsSchema string
+
+	source file.Source
 }
 
 const tableName = "schema_migrations"
 
-func (driver *Driver) Initialize(url string) error {
-	db, err := sql.Open("postgres", url)
+// SetOptions lets callers override driver defaults programmatically, in
+// addition to (or instead of) the x-migrations-table/x-migrations-schema
+// query parameters accepted by Initialize. It implements
+// driver.OptionSetter, so other drivers can adopt the same option
+// surface and callers can reach it through driver.NewWithOptions.
+func (driver *Driver) SetOptions(options map[string]string) error {
+	if table, ok := options["x-migrations-table"]; ok {
+		driver.migrationsTable = table
+	}
+	if schema, ok := options["x-migrations-schema"]; ok {
+		driver.migrationsSchema = schema
+	}
+	return nil
+}
+
+// extractMigrationsOptions pulls x-migrations-table/x-migrations-schema
+// off dsn if it's a URL carrying either, returning them alongside dsn
+// with both stripped out. A dsn with no scheme (e.g. a plain libpq
+// keyword/value string like "host=localhost dbname=mydb
+// sslmode=disable") or a URL carrying neither parameter is returned
+// completely unchanged: reconstructing a keyword/value string via
+// url.Parse/u.String() would re-escape its spaces as %20 and corrupt it
+// before it ever reaches sql.Open.
+func extractMigrationsOptions(dsn string) (table, schema, rewrittenDSN string) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		return "", "", dsn
+	}
+
+	query := u.Query()
+	table = query.Get("x-migrations-table")
+	schema = query.Get("x-migrations-schema")
+	if table == "" && schema == "" {
+		return "", "", dsn
+	}
+
+	query.Del("x-migrations-table")
+	query.Del("x-migrations-schema")
+	u.RawQuery = query.Encode()
+	return table, schema, u.String()
+}
+
+// Initialize opens dsn, which may be either a postgres:// connection URL
+// (optionally carrying x-migrations-table/x-migrations-schema query
+// parameters) or a plain libpq keyword/value DSN.
+func (driver *Driver) Initialize(dsn string) error {
+	table, schema, dsn := extractMigrationsOptions(dsn)
+	if table != "" {
+		driver.migrationsTable = table
+	}
+	if schema != "" {
+		driver.migrationsSchema = schema
+	}
+
+	if driver.migrationsTable == "" {
+		driver.migrationsTable = tableName
+	}
+
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return err
 	}
@@ -32,11 +103,37 @@ func (driver *Driver) Initialize(url string) error {
 	return nil
 }
 
+// quoteIdentifier quotes name as a single Postgres identifier, doubling
+// any embedded double quotes per the identifier-quoting rules in the PG
+// docs (not Go's %q, which backslash-escapes instead and would let a
+// quote in name break out of the identifier into surrounding SQL).
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// quotedTableName returns the driver's migrations table, schema-qualified
+// and identifier-quoted, e.g. "ops"."foo" or "schema_migrations".
+func (driver *Driver) quotedTableName() string {
+	if driver.migrationsSchema != "" {
+		return quoteIdentifier(driver.migrationsSchema) + "." + quoteIdentifier(driver.migrationsTable)
+	}
+	return quoteIdentifier(driver.migrationsTable)
+}
+
 func (driver *Driver) SetSimulate() error {
 	driver.simulate = true
 	return nil
 }
 
+// SetSource configures where migration file contents are read from. By
+// default migrations are read from disk via file.DefaultSource; pass a
+// different file.Source (e.g. file.NewEmbedSource, for migrations
+// compiled into the binary) to read from anywhere else instead.
+func (driver *Driver) SetSource(source file.Source) error {
+	driver.source = source
+	return nil
+}
+
 func (driver *Driver) Close() error {
 	if err := driver.db.Close(); err != nil {
 		return err
@@ -52,79 +149,208 @@ func (driver *Driver) Migrate(f file.File, pipe chan interface{}) {
 	defer close(pipe)
 	pipe <- f
 
-	tx, err := driver.db.Begin()
+	ctx := context.Background()
+
+	// Migrations are guarded by a session-level Postgres advisory lock so
+	// that concurrent migrators (e.g. several app replicas booting at
+	// once) can't both observe "no row for version N" and both try to
+	// apply it. The lock is taken on a connection of its own and held
+	// across the version bookkeeping and the user SQL below.
+	conn, err := driver.db.Conn(ctx)
 	if err != nil {
 		pipe <- err
 		return
 	}
+	defer conn.Close()
 
-	exec := func(q string, args ...interface{}) (sql.Result, error) {
+	lockKey := LockKey(driver.quotedTableName())
+	if !driver.simulate {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			pipe <- err
+			return
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+	}
+
+	rawExec := func(q string, args ...interface{}) error {
 		if driver.simulate {
 			pipe <- "--------------------------------\n" + q
-			return nil, nil
-		} else {
-			r, err := tx.Exec(q, args...)
-			return r, err
+			return nil
 		}
+		_, err := conn.ExecContext(ctx, q, args...)
+		return err
 	}
 
-	if _, err := exec("CREATE TABLE IF NOT EXISTS \"" + tableName + "\" (version int not null primary key);"); err != nil {
+	if err := driver.ensureSchemaMigrationsTable(rawExec); err != nil {
 		pipe <- err
-		if err := tx.Rollback(); err != nil {
-			pipe <- err
-		}
 		return
 	}
 
-	if f.Direction == direction.Up {
-		if _, err := exec(fmt.Sprintf("INSERT INTO \"%s\" (version) VALUES (%v)", tableName, f.Version)); err != nil {
-			pipe <- err
-			if err := tx.Rollback(); err != nil {
-				pipe <- err
-			}
+	if dirty, err := driver.isDirty(ctx, conn); err != nil {
+		pipe <- err
+		return
+	} else if dirty {
+		pipe <- errors.New(fmt.Sprintf("%s is dirty, refusing to migrate further; fix the schema by hand and call Force()", driver.quotedTableName()))
+		return
+	}
+
+	// Mark the version dirty and commit immediately, before running any
+	// user SQL: if the migration below fails outside of a transaction (or
+	// the process dies), this row survives and Migrate refuses to
+	// continue until the operator calls Force.
+	if err := rawExec(fmt.Sprintf(
+		"INSERT INTO %s (version, dirty) VALUES (%v, true) ON CONFLICT (version) DO UPDATE SET dirty = true",
+		driver.quotedTableName(), f.Version)); err != nil {
+		pipe <- err
+		return
+	}
+
+	if f.Kind == file.Go {
+		if err := driver.runGoMigration(ctx, conn, pipe, f); err != nil {
 			return
 		}
-	} else if f.Direction == direction.Down {
-		if _, err := exec(fmt.Sprintf("DELETE FROM \"%s\" WHERE version=%v", tableName, f.Version)); err != nil {
+	} else {
+		content, err := driver.readContent(f)
+		if err != nil {
 			pipe <- err
-			if err := tx.Rollback(); err != nil {
+			return
+		}
+
+		statements := splitStatements(content)
+		noTransaction := hasNoTransactionPragma(content)
+		if err := driver.runStatements(ctx, conn, pipe, f, content, statements, noTransaction); err != nil {
+			return
+		}
+
+		// migrate:no-transaction files run statement-by-statement with no
+		// surrounding transaction, so there's no tx left to clear dirty
+		// atomically with: this is a best-effort follow-up, and a crash
+		// here (unlike the transactional path) can still leave the row
+		// dirty despite every statement having succeeded.
+		if noTransaction {
+			if err := rawExec(driver.bookkeepingSQL(f)); err != nil {
 				pipe <- err
 			}
-			return
 		}
 	}
+}
 
-	if err := f.ReadContent(); err != nil {
+// bookkeepingSQL returns the statement that records f's outcome in the
+// migrations table once its SQL or Go migration has run successfully:
+// clearing dirty on the way up, removing the row on the way down.
+func (driver *Driver) bookkeepingSQL(f file.File) string {
+	if f.Direction == direction.Down {
+		return fmt.Sprintf("DELETE FROM %s WHERE version = %v", driver.quotedTableName(), f.Version)
+	}
+	return fmt.Sprintf("UPDATE %s SET dirty = false WHERE version = %v", driver.quotedTableName(), f.Version)
+}
+
+// runStatements executes statements either inside a single transaction
+// (the common case) or, when noTransaction is set, one by one directly
+// on conn, for statements such as CREATE INDEX CONCURRENTLY that
+// Postgres refuses to run inside a transaction block. It reports any
+// failure to pipe and returns a non-nil error.
+//
+// In the transactional case, the dirty-clearing/version-removing
+// bookkeeping statement for f runs as the last statement of the same
+// tx, so a crash between the user SQL and the bookkeeping update can't
+// leave a fully-applied migration marked dirty.
+func (driver *Driver) runStatements(ctx context.Context, conn *sql.Conn, pipe chan interface{}, f file.File, content []byte, statements []statement, noTransaction bool) error {
+	if noTransaction {
+		for _, stmt := range statements {
+			if driver.simulate {
+				pipe <- "--------------------------------\n" + stmt.sql
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, stmt.sql); err != nil {
+				pipe <- driver.statementError(err, content, stmt)
+				return err
+			}
+		}
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
 		pipe <- err
-		return
+		return err
 	}
 
-	if _, err := exec(string(f.Content)); err != nil {
-		pqErr := err.(*pq.Error)
-		offset, err := strconv.Atoi(pqErr.Position)
-		if err == nil && offset >= 0 {
-			lineNo, columnNo := file.LineColumnFromOffset(f.Content, offset-1)
-			errorPart := file.LinesBeforeAndAfter(f.Content, lineNo, 5, 5, true)
-			pipe <- errors.New(fmt.Sprintf("%s %v: %s in line %v, column %v:\n\n%s", pqErr.Severity, pqErr.Code, pqErr.Message, lineNo, columnNo, string(errorPart)))
-		} else {
-			pipe <- errors.New(fmt.Sprintf("%s %v: %s", pqErr.Severity, pqErr.Code, pqErr.Message))
+	for _, stmt := range statements {
+		if driver.simulate {
+			pipe <- "--------------------------------\n" + stmt.sql
+			continue
 		}
+		if _, err := tx.Exec(stmt.sql); err != nil {
+			pipe <- driver.statementError(err, content, stmt)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				pipe <- rbErr
+			}
+			return err
+		}
+	}
 
-		if err := tx.Rollback(); err != nil {
-			pipe <- err
+	bookkeeping := driver.bookkeepingSQL(f)
+	if driver.simulate {
+		pipe <- "--------------------------------\n" + bookkeeping
+		return nil
+	}
+
+	if _, err := tx.Exec(bookkeeping); err != nil {
+		pipe <- err
+		if rbErr := tx.Rollback(); rbErr != nil {
+			pipe <- rbErr
 		}
-		return
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
 		pipe <- err
-		return
+		return err
 	}
+	return nil
+}
+
+// readContent returns f's migration SQL, going through the driver's
+// configured file.Source (see SetSource) when one has been set, and
+// falling back to file.DefaultSource, reading f.Path joined with
+// f.FileName off disk, otherwise. This is the single point through which
+// .sql content reaches the driver, so that sources such as an embed.FS
+// work exactly like migrations read from disk.
+func (driver *Driver) readContent(f file.File) ([]byte, error) {
+	if driver.source != nil {
+		return driver.source.ReadFile(f.FileName)
+	}
+	return file.DefaultSource.ReadFile(filepath.Join(f.Path, f.FileName))
+}
+
+// statementError turns a failed statement's *pq.Error into an error that
+// reports the line/column of the failure within the original migration
+// file, by translating the statement-relative position pq gives us into
+// an offset into the full file content.
+func (driver *Driver) statementError(err error, content []byte, stmt statement) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+
+	offset, convErr := strconv.Atoi(pqErr.Position)
+	if convErr != nil || offset < 0 {
+		return errors.New(fmt.Sprintf("%s %v: %s", pqErr.Severity, pqErr.Code, pqErr.Message))
+	}
+
+	fileOffset := stmt.offset + offset - 1
+	lineNo, columnNo := file.LineColumnFromOffset(content, fileOffset)
+	errorPart := file.LinesBeforeAndAfter(content, lineNo, 5, 5, true)
+	return errors.New(fmt.Sprintf("%s %v: %s in line %v, column %v:\n\n%s", pqErr.Severity, pqErr.Code, pqErr.Message, lineNo, columnNo, string(errorPart)))
 }
 
+// Version returns the highest version that is not dirty. A dirty row
+// means a previous migration failed partway through, so it must not be
+// reported as applied until the operator calls Force.
 func (driver *Driver) Version() (uint64, error) {
 	var version uint64
-	err := driver.db.QueryRow("SELECT version FROM " + tableName + " ORDER BY version DESC LIMIT 1").Scan(&version)
+	err := driver.db.QueryRow("SELECT version FROM " + driver.quotedTableName() + " WHERE NOT dirty ORDER BY version DESC LIMIT 1").Scan(&version)
 	switch {
 	case err == sql.ErrNoRows:
 		return 0, nil
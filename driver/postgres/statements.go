@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"bytes"
+	"strings"
+)
+
+// noTransactionPragma, when present as a leading comment in a migration
+// file, tells Migrate to run the file's statements outside of a
+// surrounding BEGIN/COMMIT. This is required for statements such as
+// CREATE INDEX CONCURRENTLY that Postgres refuses to run inside a
+// transaction block.
+const noTransactionPragma = "migrate:no-transaction"
+
+// hasNoTransactionPragma reports whether content opts out of the
+// transaction that Migrate would otherwise wrap it in.
+func hasNoTransactionPragma(content []byte) bool {
+	for _, line := range bytes.SplitN(content, []byte("\n"), 20) {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(trimmed, []byte("--")) {
+			break
+		}
+		if bytes.Contains(trimmed, []byte(noTransactionPragma)) {
+			return true
+		}
+	}
+	return false
+}
+
+// statement is a single SQL statement extracted from a migration file,
+// together with the byte offset at which it starts in the original
+// file content, so that driver errors can be reported against the
+// original file rather than the (otherwise invisible) extracted
+// statement.
+type statement struct {
+	sql    string
+	offset int
+}
+
+// splitStatements splits content into individual, semicolon-terminated
+// SQL statements. It understands single-quoted string literals,
+// dollar-quoted strings ($$...$$ and $tag$...$tag$), and -- and /* */
+// comments, so that semicolons inside any of those are not treated as
+// statement separators.
+func splitStatements(content []byte) []statement {
+	var statements []statement
+	start := 0
+
+	i := 0
+	n := len(content)
+	for i < n {
+		switch c := content[i]; c {
+		case '\'':
+			i = skipQuoted(content, i, '\'')
+		case '"':
+			i = skipQuoted(content, i, '"')
+		case '$':
+			if tag, end, ok := dollarTagAt(content, i); ok {
+				i = skipDollarQuoted(content, end, tag)
+				continue
+			}
+			i++
+		case '-':
+			if i+1 < n && content[i+1] == '-' {
+				i = skipLineComment(content, i)
+				continue
+			}
+			i++
+		case '/':
+			if i+1 < n && content[i+1] == '*' {
+				i = skipBlockComment(content, i)
+				continue
+			}
+			i++
+		case ';':
+			if s := strings.TrimSpace(string(content[start : i+1])); s != "" && s != ";" {
+				statements = append(statements, statement{sql: s, offset: trimmedOffset(content, start, i+1)})
+			}
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+
+	if s := strings.TrimSpace(string(content[start:])); s != "" {
+		statements = append(statements, statement{sql: s, offset: trimmedOffset(content, start, len(content))})
+	}
+
+	return statements
+}
+
+// trimmedOffset returns the offset of the first non-whitespace byte in
+// content[start:end]. A statement's sql field is strings.TrimSpace'd, so
+// its real start in content is shifted past any blank line or other
+// whitespace immediately following the previous statement's semicolon
+// (a leading comment is not shifted past: it's part of the statement
+// text, not trimmed); offset must track that shift for statementError's
+// line/column reporting to point at the right place.
+func trimmedOffset(content []byte, start, end int) int {
+	for start < end && isSpaceByte(content[start]) {
+		start++
+	}
+	return start
+}
+
+func isSpaceByte(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+func skipQuoted(content []byte, i int, quote byte) int {
+	i++ // opening quote
+	for i < len(content) {
+		if content[i] == quote {
+			// a doubled quote is an escaped quote, not the closing one
+			if i+1 < len(content) && content[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+// dollarTagAt checks whether content[i:] begins a dollar-quote opener
+// such as $$ or $tag$, returning the tag (without dollars) and the
+// offset just past the opener.
+func dollarTagAt(content []byte, i int) (tag string, end int, ok bool) {
+	j := i + 1
+	for j < len(content) && (isAlnum(content[j]) || content[j] == '_') {
+		j++
+	}
+	if j < len(content) && content[j] == '$' {
+		return string(content[i+1 : j]), j + 1, true
+	}
+	return "", 0, false
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func skipDollarQuoted(content []byte, i int, tag string) int {
+	closer := "$" + tag + "$"
+	if idx := strings.Index(string(content[i:]), closer); idx >= 0 {
+		return i + idx + len(closer)
+	}
+	return len(content)
+}
+
+func skipLineComment(content []byte, i int) int {
+	for i < len(content) && content[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+func skipBlockComment(content []byte, i int) int {
+	i += 2
+	for i+1 < len(content) {
+		if content[i] == '*' && content[i+1] == '/' {
+			return i + 2
+		}
+		i++
+	}
+	return len(content)
+}
@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestSplitStatements(t *testing.T) {
+	content := []byte(`
+-- a comment; with a semicolon
+CREATE TABLE foo (id int);
+
+CREATE FUNCTION bar() RETURNS void AS $$
+BEGIN
+  -- semicolons inside the body must not split the statement;
+  PERFORM 1;
+END;
+$$ LANGUAGE plpgsql;
+
+INSERT INTO foo (id) VALUES ('a;b');
+`)
+
+	statements := splitStatements(content)
+	if len(statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d: %#v", len(statements), statements)
+	}
+}
+
+func TestSplitStatementsOffsetSkipsLeadingBlankLine(t *testing.T) {
+	// A blank line separates the two statements, exactly as migration
+	// files commonly format them: stmt.sql is left-trimmed of it (the
+	// leading comment, by contrast, is part of the statement text, not
+	// trimmed), so offset must point past the blank line, not at the
+	// preceding semicolon.
+	content := []byte("CREATE TABLE foo (id int);\n\n-- a comment before the failing statement\nSELECT bogus_column FROM foo;\n")
+
+	statements := splitStatements(content)
+	if len(statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d: %#v", len(statements), statements)
+	}
+
+	stmt := statements[1]
+	if !strings.HasPrefix(stmt.sql, "-- a comment") {
+		t.Fatalf("expected second statement to start with the comment, got %q", stmt.sql)
+	}
+	if content[stmt.offset] != '-' {
+		t.Fatalf("expected offset %d to point at stmt.sql's leading comment, got %q", stmt.offset, content[stmt.offset])
+	}
+}
+
+func TestStatementErrorReportsLineAfterLeadingBlankLineAndComment(t *testing.T) {
+	content := []byte("CREATE TABLE foo (id int);\n\n-- a comment before the failing statement\nSELECT bogus_column FROM foo;\n")
+
+	statements := splitStatements(content)
+	stmt := statements[1]
+
+	pos := strings.Index(stmt.sql, "bogus_column") + 1
+	pqErr := &pq.Error{
+		Severity: "ERROR",
+		Code:     "42703",
+		Message:  `column "bogus_column" does not exist`,
+		Position: strconv.Itoa(pos),
+	}
+
+	driver := &Driver{}
+	err := driver.statementError(pqErr, content, stmt)
+	if !strings.Contains(err.Error(), "line 4") {
+		t.Fatalf("expected error to report line 4 (where bogus_column is, below the statement's leading comment), got: %v", err)
+	}
+}
+
+func TestHasNoTransactionPragma(t *testing.T) {
+	if !hasNoTransactionPragma([]byte("-- migrate:no-transaction\nCREATE INDEX CONCURRENTLY foo ON bar (id);")) {
+		t.Fatalf("expected pragma to be detected")
+	}
+	if hasNoTransactionPragma([]byte("CREATE TABLE foo (id int);")) {
+		t.Fatalf("did not expect pragma to be detected")
+	}
+}
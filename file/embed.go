@@ -0,0 +1,44 @@
+package file
+
+import (
+	"io/fs"
+	"os"
+)
+
+// EmbedSource adapts an embed.FS (or any other io/fs.FS) to Source, so
+// that applications shipping as a single Go binary can compile their
+// .sql migrations in rather than shipping a migrations directory
+// alongside it, e.g.:
+//
+//	//go:embed migrations/*.sql
+//	var migrationsFS embed.FS
+//	driver.SetSource(file.NewEmbedSource(migrationsFS))
+type EmbedSource struct {
+	fsys fs.FS
+}
+
+// NewEmbedSource returns a Source backed by fsys.
+func NewEmbedSource(fsys fs.FS) EmbedSource {
+	return EmbedSource{fsys: fsys}
+}
+
+func (s EmbedSource) ReadDir(dirname string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(s.fsys, dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s EmbedSource) ReadFile(filename string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, filename)
+}
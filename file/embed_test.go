@@ -0,0 +1,30 @@
+package file
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbedSourceReadFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_init.up.sql": {Data: []byte("CREATE TABLE foo (id int);")},
+	}
+
+	source := NewEmbedSource(fsys)
+
+	content, err := source.ReadFile("migrations/0001_init.up.sql")
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if string(content) != "CREATE TABLE foo (id int);" {
+		t.Fatalf("unexpected content: %s", content)
+	}
+
+	infos, err := source.ReadDir("migrations")
+	if err != nil {
+		t.Fatalf("ReadDir returned error: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "0001_init.up.sql" {
+		t.Fatalf("unexpected ReadDir result: %#v", infos)
+	}
+}
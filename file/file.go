@@ -0,0 +1,47 @@
+package file
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/mattes/migrate/migrate/direction"
+)
+
+// Kind distinguishes a migration backed by a .sql file's Content (SQL,
+// the default) from one backed by a Go function registered with a
+// driver (Go; see postgres.RegisterMigration). Driver.Migrate branches
+// on Kind to decide how to run a File.
+type Kind int
+
+const (
+	SQL Kind = iota
+	Go
+)
+
+// File represents one migration, in a single direction, discovered by
+// the migrate loop. FileName is the full on-disk filename (e.g.
+// "0001_init.up.sql") and is what a Source's ReadFile expects; Name is
+// just the descriptive component parsed out of it (e.g. "init"). Kind Go
+// files have no .sql file backing them at all, so FileName and Content
+// are left zero.
+type File struct {
+	Path      string
+	FileName  string
+	Version   uint64
+	Name      string
+	Direction direction.Direction
+	Content   []byte
+	Kind      Kind
+}
+
+// ReadContent reads the file's content from Path/FileName into Content.
+// It is only meaningful for Kind SQL files; Kind Go files run a
+// registered function instead and have nothing to read.
+func (f *File) ReadContent() error {
+	content, err := ioutil.ReadFile(filepath.Join(f.Path, f.FileName))
+	if err != nil {
+		return err
+	}
+	f.Content = content
+	return nil
+}
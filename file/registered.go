@@ -0,0 +1,32 @@
+package file
+
+import "github.com/mattes/migrate/migrate/direction"
+
+// MergeRegistered adds a Kind Go File for every version in
+// registeredVersions that doesn't already have a File of direction d in
+// files, so that the migrate loop's normal directory scan can surface
+// registered-but-fileless Go migrations (see postgres.RegisterMigration)
+// alongside ordinary .sql files of the same version. A version that has
+// both a .sql file and a registered Go migration keeps its .sql file;
+// the two are not merged.
+func MergeRegistered(files []File, registeredVersions []uint64, d direction.Direction) []File {
+	haveFile := make(map[uint64]bool, len(files))
+	for _, f := range files {
+		if f.Direction == d {
+			haveFile[f.Version] = true
+		}
+	}
+
+	merged := files
+	for _, version := range registeredVersions {
+		if haveFile[version] {
+			continue
+		}
+		merged = append(merged, File{
+			Version:   version,
+			Direction: d,
+			Kind:      Go,
+		})
+	}
+	return merged
+}
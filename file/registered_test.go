@@ -0,0 +1,45 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/mattes/migrate/migrate/direction"
+)
+
+func TestMergeRegisteredAddsFilelessVersions(t *testing.T) {
+	files := []File{
+		{Version: 1, FileName: "0001_init.up.sql", Direction: direction.Up, Kind: SQL},
+	}
+
+	merged := MergeRegistered(files, []uint64{1, 2}, direction.Up)
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 files, got %d: %#v", len(merged), merged)
+	}
+
+	var found2 bool
+	for _, f := range merged {
+		if f.Version == 2 {
+			found2 = true
+			if f.Kind != Go {
+				t.Fatalf("expected synthesized version 2 to have Kind Go, got %v", f.Kind)
+			}
+		}
+		if f.Version == 1 && f.Kind != SQL {
+			t.Fatalf("expected existing .sql file for version 1 to be left alone, got Kind %v", f.Kind)
+		}
+	}
+	if !found2 {
+		t.Fatalf("expected version 2 to be synthesized, got %#v", merged)
+	}
+}
+
+func TestMergeRegisteredDoesNotDuplicateExistingFile(t *testing.T) {
+	files := []File{
+		{Version: 1, FileName: "0001_init.up.sql", Direction: direction.Up, Kind: SQL},
+	}
+
+	merged := MergeRegistered(files, []uint64{1}, direction.Up)
+	if len(merged) != 1 {
+		t.Fatalf("expected no duplicate for a version that already has a file, got %#v", merged)
+	}
+}
@@ -0,0 +1,33 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// Source abstracts away where migration files are read from, so that
+// migrations need not live on disk. ReadDir lists the migration files in
+// dirname (as os.ReadDir would); ReadFile returns the contents of a
+// single migration file, where filename is a path from the same root as
+// ReadDir's dirname (dirname joined with a name ReadDir returned), not
+// the bare name alone.
+type Source interface {
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	ReadFile(filename string) ([]byte, error)
+}
+
+// osSource implements Source by reading migrations directly off disk. It
+// is the default source used when no other Source has been configured,
+// and is what the package has always done.
+type osSource struct{}
+
+// DefaultSource reads migrations from the local filesystem.
+var DefaultSource Source = osSource{}
+
+func (osSource) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
+func (osSource) ReadFile(filename string) ([]byte, error) {
+	return ioutil.ReadFile(filename)
+}
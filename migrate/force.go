@@ -0,0 +1,28 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/mattes/migrate/driver"
+)
+
+// Force marks version as applied and clears its dirty flag without
+// running any migration SQL. It is the operator's escape hatch after a
+// migration fails mid-file and leaves schema_migrations dirty: once the
+// underlying schema issue is fixed by hand, forcing the dirty version
+// tells migrate it's safe to continue. Rows for other versions are left
+// as they are, so a dirty row at another version still blocks migrating.
+func Force(url string, version uint64) error {
+	d, err := driver.New(url)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	forcer, ok := d.(driver.Forcer)
+	if !ok {
+		return fmt.Errorf("migrate: driver does not support Force")
+	}
+
+	return forcer.Force(version)
+}